@@ -19,16 +19,38 @@ Use a JSON file that looks like
 
 Put the file in $HOME/.email/email-config.json
 
+Besides the basic Username/Password/EmailServer/Port, EmailUser also
+configures: TLSPolicy/SkipVerify/ServerName for STARTTLS vs implicit TLS
+(see dialSmtp); and Type/APIKey/Domain/Region/SendmailPath/DevDir to pick a
+delivery Transport other than SMTP (see transport.go) - "sendgrid" and
+"ses" have no built-in Transport, since SendGrid's API doesn't accept a raw
+MIME body and SES needs SigV4-signed requests, so those two Types only work
+if EM.Transport is set to a caller-supplied implementation.
+
+Beyond the builder methods below (To/Cc/Bcc/From/Subject/TextBody/
+HtmlBody/Attach), Embed/EmbedImage add inline images referenced from an
+HTML body via "cid:", TextTemplate/HtmlTemplate (template.go) render
+text/html templates as the body - HtmlTemplate auto-embeds any "cid:"/
+"file:" image it finds, Dial/Sender (sender.go) reuse one SMTP connection
+across many messages with retry and reconnect, and EMLToEm/EMLFromFile/
+EMLFromString/WriteEML/SaveEML (eml.go) parse and serialize RFC 5322 .eml
+messages.
+
 */
 package em
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"mime"
+	"mime/quotedprintable"
+	"net"
 	"net/smtp"
 	"path/filepath"
 	"strconv"
@@ -43,12 +65,43 @@ const (
 	Version = "Version: 1.0.0"
 )
 
+// Encoding is the Content-Transfer-Encoding used for text/plain and text/html
+// bodies.
+type Encoding string
+
+const (
+	QuotedPrintable Encoding = "quoted-printable"
+	Base64          Encoding = "base64"
+)
+
+// TLSPolicy controls how SendIt negotiates transport security with the SMTP
+// server.
+type TLSPolicy string
+
+const (
+	TLSNone          TLSPolicy = "none"          // never use TLS, even if the server offers STARTTLS
+	TLSOpportunistic TLSPolicy = "opportunistic" // use STARTTLS if the server offers it, plaintext otherwise (default)
+	TLSMandatory     TLSPolicy = "mandatory"     // require STARTTLS; fail if the server does not offer it
+	TLSImplicit      TLSPolicy = "implicit"      // dial straight into TLS, e.g. smtp.gmail.com:465
+)
+
 // ---------------------------------------------------------------------------------------------------------------------
 type EmailUser struct {
 	Username    string // Something like you@yourdomain.com
 	Password    string // Your paassword like password123
 	EmailServer string // smtp.gmail.com
 	Port        int    // 587 for example
+
+	TLSPolicy  TLSPolicy // none/opportunistic/mandatory/implicit, defaults to opportunistic
+	SkipVerify bool      // skip TLS certificate verification - for self-signed corporate relays
+	ServerName string    // TLS ServerName to verify against, defaults to EmailServer
+
+	Type         string // "smtp" (default), "mailgun", "sendgrid", "ses", "sendmail", or "dev"
+	APIKey       string // Mailgun/SendGrid API key
+	Domain       string // Mailgun sending domain
+	Region       string // SES region, e.g. "us-east-1"
+	SendmailPath string // path to the sendmail binary, defaults to /usr/sbin/sendmail
+	DevDir       string // dev Type: directory to write .eml files to; stdout if empty
 }
 
 type EM struct {
@@ -58,11 +111,20 @@ type EM struct {
 	Message     *mailbuilder.Message
 	Alt         *mailbuilder.MultiPart
 	Mixed       *mailbuilder.MultiPart
+	Related     *mailbuilder.MultiPart
+	Headers     map[string][]string // every raw top-level header from EMLToEm, including ones not otherwise modeled, e.g. Message-ID, Date; informational only, not re-emitted by WriteEML/SendIt
+	Transport   Transport           // overrides EmailConfig.Type's dispatch when set; required for providers with no built-in Transport (e.g. SendGrid, SES)
 	Err         error
 
 	altSetup      bool
+	bodyAttached  bool
+	attachments   []*mailbuilder.SimplePart // collected by Attach/attachBytes, wired into Mixed by attachBody
 	lineMaxLength int
 	printErrors   bool
+	charset       string
+	encoding      Encoding
+	templateDir   string
+	templateFS    fs.FS
 }
 
 // ---------------------------------------------------------------------------------------------------------------------
@@ -91,7 +153,7 @@ func (this *EM) readEmailConfig(fn string) (rv EmailUser, err error) {
 
 func NewEmFile(fn string, pe bool) *EM {
 	var err error
-	x := EM{EmailCfgFn: fn, altSetup: false, lineMaxLength: 500, printErrors: pe, Err: nil}
+	x := EM{EmailCfgFn: fn, altSetup: false, lineMaxLength: 500, printErrors: pe, Err: nil, charset: "UTF-8", encoding: QuotedPrintable}
 	if fn[0:1] == "/" {
 		x.EmailConfig, err = x.readEmailConfig(x.EmailCfgFn)
 	} else if fn[0:2] == "~/" {
@@ -110,7 +172,7 @@ func NewEmFile(fn string, pe bool) *EM {
 }
 
 func NewEm(ec EmailUser) *EM {
-	x := EM{EmailCfgFn: "", altSetup: false, lineMaxLength: 500, printErrors: true, Err: nil}
+	x := EM{EmailCfgFn: "", altSetup: false, lineMaxLength: 500, printErrors: true, Err: nil, charset: "UTF-8", encoding: QuotedPrintable}
 	x.EmailConfig = ec
 	x.initEM()
 	return &x
@@ -129,33 +191,100 @@ func (this *EM) SetPrintErrors(b bool) {
 	this.printErrors = b
 }
 
+// The default charset is UTF-8.  Should be called after NewEmFile or NewEm
+// and before any call that encodes with it - TextBody/HtmlBody/Subject as
+// well as To/Cc/Bcc/From, which encode their display name at call time -
+// so the new charset is used throughout instead of only partway through.
+func (this *EM) SetCharset(charset string) {
+	this.charset = charset
+}
+
+// The default Content-Transfer-Encoding is QuotedPrintable.  Pass Base64 to
+// use base64 instead.  Should be called after NewEmFile or NewEm and before
+// TextBody/HtmlBody.
+func (this *EM) SetEncoding(enc Encoding) {
+	this.encoding = enc
+}
+
+// encodeWord RFC 2047 encodes s for use in a header, such as Subject or an
+// address display name, so international characters survive transport.
+// Pure-ASCII strings are returned unchanged.
+func (this *EM) encodeWord(s string) string {
+	return mime.QEncoding.Encode(this.charset, s)
+}
+
+// encodeBase64Lines base64-encodes content and wraps it to lineMaxLength
+// columns, as required for MIME parts.
+func (this *EM) encodeBase64Lines(content []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	nbrLines := len(encoded) / this.lineMaxLength
+	var buf bytes.Buffer
+	for i := 0; i < nbrLines; i++ {
+		buf.WriteString(encoded[i*this.lineMaxLength:(i+1)*this.lineMaxLength] + "\n")
+	}
+	buf.WriteString(encoded[nbrLines*this.lineMaxLength:])
+	return buf.String()
+}
+
+// encodeContent runs s through the configured Content-Transfer-Encoding
+// (quoted-printable or base64) so that non-ASCII body text round-trips
+// correctly.
+func (this *EM) encodeContent(s string) string {
+	var buf bytes.Buffer
+	if this.encoding == Base64 {
+		encoded := base64.StdEncoding.EncodeToString([]byte(s))
+		nbrLines := len(encoded) / this.lineMaxLength
+		for i := 0; i < nbrLines; i++ {
+			buf.WriteString(encoded[i*this.lineMaxLength:(i+1)*this.lineMaxLength] + "\n")
+		}
+		buf.WriteString(encoded[nbrLines*this.lineMaxLength:])
+	} else {
+		w := quotedprintable.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+	}
+	return buf.String()
+}
+
+// TextTemplate/HtmlTemplate load named template files from dir.  Ignored
+// while a template fs.FS is set with SetTemplateFS, which takes precedence.
+func (this *EM) SetTemplateDir(dir string) {
+	this.templateDir = dir
+}
+
+// TextTemplate/HtmlTemplate load named template files from fsys instead of a
+// directory on disk.
+func (this *EM) SetTemplateFS(fsys fs.FS) {
+	this.templateFS = fsys
+}
+
 // Set the destination address, may be called more than onece.
 func (this *EM) To(addr string, name string) *EM {
-	this.Message.AddTo(mailbuilder.NewAddress(addr, name))
+	this.Message.AddTo(mailbuilder.NewAddress(addr, this.encodeWord(name)))
 	return this
 }
 
 // Set the CC: destination address, may be called more than onece.
 func (this *EM) Cc(addr string, name string) *EM {
-	this.Message.AddCc(mailbuilder.NewAddress(addr, name))
+	this.Message.AddCc(mailbuilder.NewAddress(addr, this.encodeWord(name)))
 	return this
 }
 
 // Set the BCC: destination address, may be called more than onece.
 func (this *EM) Bcc(addr string, name string) *EM {
-	this.Message.AddBcc(mailbuilder.NewAddress(addr, name))
+	this.Message.AddBcc(mailbuilder.NewAddress(addr, this.encodeWord(name)))
 	return this
 }
 
 // Set the source of the message
 func (this *EM) From(addr string, name string) *EM {
-	this.Message.From = mailbuilder.NewAddress(addr, name)
+	this.Message.From = mailbuilder.NewAddress(addr, this.encodeWord(name))
 	return this
 }
 
 // Set the Subject for the email.
 func (this *EM) Subject(s string) *EM {
-	this.Message.Subject = s
+	this.Message.Subject = this.encodeWord(s)
 	return this
 }
 
@@ -164,8 +293,30 @@ func (this *EM) doAltSetup() {
 		this.altSetup = true
 		this.Alt = mailbuilder.NewMultiPart("multipart/alternative")
 		this.Mixed = mailbuilder.NewMultiPart("multipart/mixed")
+	}
+}
+
+// attachBody wires the final mixed part together: the alternative
+// (text/plain + text/html) part - wrapped in a multipart/related subtree if
+// Embed/EmbedImage added inline images - followed by every attachment
+// collected by Attach.  This is deferred to a single point, called only from
+// SendIt/WriteEML/Sender.Send once all of Attach/Embed/EmbedImage have been
+// called, because any of them may be called in any order relative to the
+// others.
+func (this *EM) attachBody() {
+	if this.bodyAttached {
+		return
+	}
+	this.bodyAttached = true
+	if this.Related != nil {
+		this.Related.AddPart(this.Alt)
+		this.Mixed.AddPart(this.Related)
+	} else {
 		this.Mixed.AddPart(this.Alt)
 	}
+	for _, attch := range this.attachments {
+		this.Mixed.AddPart(attch)
+	}
 }
 
 // Send a Text body with the email.
@@ -173,11 +324,9 @@ func (this *EM) TextBody(s string) *EM {
 	this.doAltSetup()
 
 	text := mailbuilder.NewSimplePart()
-	// add content/headers to html and text
-	//text.AddHeader("Content-Type", "text/plain; charset=utf8")
-	//text.AddHeader("Content-Transfer-Encoding", "quoted-printable")
-	text.AddHeader("Content-Type", "text/plain; charset=us-ascii")
-	text.Content = s
+	text.AddHeader("Content-Type", fmt.Sprintf("text/plain; charset=%s", this.charset))
+	text.AddHeader("Content-Transfer-Encoding", string(this.encoding))
+	text.Content = this.encodeContent(s)
 	this.Alt.AddPart(text)
 	return this
 }
@@ -187,15 +336,50 @@ func (this *EM) HtmlBody(s string) *EM {
 	this.doAltSetup()
 
 	html := mailbuilder.NewSimplePart()
-	// add content/headers to html and text
-	//	html.AddHeader("Content-Type", "text/html; charset=utf8")
-	//	html.AddHeader("Content-Transfer-Encoding", "quoted-printable")
-	html.AddHeader("Content-Type", "text/html; charset=us-ascii")
-	html.Content = s
+	html.AddHeader("Content-Type", fmt.Sprintf("text/html; charset=%s", this.charset))
+	html.AddHeader("Content-Transfer-Encoding", string(this.encoding))
+	html.Content = this.encodeContent(s)
 	this.Alt.AddPart(html)
 	return this
 }
 
+// Embed attaches a file as an inline part with the given Content-ID, so that an
+// HTML body can reference it with a "cid:" URL, e.g. <img src="cid:logo.png">.
+// Unlike Attach, the part is added to a multipart/related subtree wrapped
+// around the text/html alternative instead of going straight into
+// multipart/mixed.
+func (this *EM) Embed(fn string, cid string) *EM {
+	this.doAltSetup()
+
+	if this.Related == nil {
+		this.Related = mailbuilder.NewMultiPart("multipart/related")
+	}
+
+	bfn := filepath.Base(fn)
+	ext := filepath.Ext(fn)
+	ct := mime.TypeByExtension(ext)
+
+	part := mailbuilder.NewSimplePart()
+	part.AddHeader("Content-Type", ct)
+	part.AddHeader("Content-Transfer-Encoding", "base64")
+	part.AddHeader("Content-Disposition", fmt.Sprintf(`inline; filename=%q`, bfn))
+	part.AddHeader("Content-ID", fmt.Sprintf("<%s>", cid))
+
+	//read and encode the embedded file
+	content, _ := ioutil.ReadFile(fn)
+	part.Content = this.encodeBase64Lines(content)
+
+	this.Related.AddPart(part)
+	return this
+}
+
+// EmbedImage attaches fn as an inline image with a Content-ID generated from
+// its base file name, so it can be referenced from an HTML body as
+// src="cid:<basefilename>".
+func (this *EM) EmbedImage(fn string) *EM {
+	return this.Embed(fn, filepath.Base(fn))
+}
+
 // Attach a file to the email - may be a relative path.  The file name that is sent in
 // the email will be the base file name.
 func (this *EM) Attach(fn string) *EM {
@@ -212,48 +396,123 @@ func (this *EM) Attach(fn string) *EM {
 
 	//read and encode attachment
 	content, _ := ioutil.ReadFile(fn)
-	encoded := base64.StdEncoding.EncodeToString(content)
-	//split the encoded file in lines (doesn't matter, but low enough not to hit a max limit)
-	nbrLines := len(encoded) / this.lineMaxLength
-	var buf bytes.Buffer
-	for i := 0; i < nbrLines; i++ {
-		buf.WriteString(encoded[i*this.lineMaxLength:(i+1)*this.lineMaxLength] + "\n")
-	}
-	buf.WriteString(encoded[nbrLines*this.lineMaxLength:])
-	attch.Content = buf.String()
+	attch.Content = this.encodeBase64Lines(content)
 
-	this.Mixed.AddPart(attch)
+	this.attachments = append(this.attachments, attch)
 	return this
 }
 
-// Last call.  This sends the message.
-func (this *EM) SendIt() (err error) {
+// sendError formats, optionally prints, and records an SMTP send error.
+func (this *EM) sendError(err error) error {
+	e := fmt.Sprintf("Error(12021): SMTP Send Error: %v", err)
+	if this.printErrors {
+		fmt.Printf("%s\n", e)
+	}
+	err = errors.New(e)
+	this.Err = err
+	return err
+}
+
+// dialSmtp connects to EmailConfig's server, performs the TLS/STARTTLS
+// handshake according to EmailConfig.TLSPolicy, and authenticates, returning
+// a ready-to-use *smtp.Client.  Shared by SendIt (one-shot) and Sender
+// (persistent connections).
+func (this *EM) dialSmtp() (*smtp.Client, error) {
+	addr := this.EmailConfig.EmailServer + ":" + strconv.Itoa(this.EmailConfig.Port)
+	serverName := this.EmailConfig.ServerName
+	if serverName == "" {
+		serverName = this.EmailConfig.EmailServer
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: this.EmailConfig.SkipVerify,
+	}
+
+	var conn net.Conn
+	var err error
+	if this.EmailConfig.TLSPolicy == TLSImplicit {
+		conn, err = tls.Dial("tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, this.EmailConfig.EmailServer)
+	if err != nil {
+		return nil, err
+	}
+
+	if this.EmailConfig.TLSPolicy != TLSImplicit && this.EmailConfig.TLSPolicy != TLSNone {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else if this.EmailConfig.TLSPolicy == TLSMandatory {
+			client.Close()
+			return nil, errors.New("Error(12025): Server does not offer STARTTLS and TLSPolicy is mandatory")
+		}
+	}
+
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err = client.Auth(this.SmtpAuth); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
 
+// Last call.  This sends the message.  Delivery goes through the Transport
+// implied by EmailConfig.Type (defaulting to "smtp"); see transport.go for
+// the mailgun/sendgrid/ses/sendmail/dev alternatives.  To reuse one SMTP
+// connection across many messages instead, use Dial and Sender.Send.
+func (this *EM) SendIt() (err error) {
 	if !this.altSetup {
 		err = errors.New("Error(12022): Can not send an email without a body or attachments.")
 		return
 	}
-
+	this.attachBody()
 	this.Message.SetBody(this.Mixed)
 
-	err = smtp.SendMail(this.EmailConfig.EmailServer+":"+strconv.Itoa(this.EmailConfig.Port),
-		this.SmtpAuth,
-		this.Message.From.Email,
-		this.Message.Recipients(),
-		this.Message.Bytes())
-
+	t, err := this.transport()
 	if err != nil {
-		e := fmt.Sprintf("Error(12021): SMTP Send Error: %v", err)
-		if this.printErrors {
-			fmt.Printf("%s\n", e)
-		}
-		err = errors.New(e)
-		this.Err = err
+		err = this.sendError(err)
+		return
 	}
 
-	this.Message = mailbuilder.NewMessage()
+	if err = t.Send(this.Message.From.Email, this.Message.Recipients(), this.Message.Bytes()); err != nil {
+		err = this.sendError(err)
+		return
+	}
 
+	this.Message = mailbuilder.NewMessage()
 	return
 }
 
+// WriteEML serializes the fully built message to RFC 5322 .eml bytes on w,
+// without sending it.  Use EMLToEm to parse it back.
+func (this *EM) WriteEML(w io.Writer) error {
+	if !this.altSetup {
+		return errors.New("Error(12022): Can not send an email without a body or attachments.")
+	}
+	this.attachBody()
+	this.Message.SetBody(this.Mixed)
+
+	_, err := w.Write(this.Message.Bytes())
+	return err
+}
+
+// SaveEML writes the fully built message to path as an RFC 5322 .eml file.
+func (this *EM) SaveEML(path string) error {
+	var buf bytes.Buffer
+	if err := this.WriteEML(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
 /* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,43 @@
+package em
+
+import (
+	"bytes"
+	"mime/quotedprintable"
+	"testing"
+)
+
+func TestEncodeWord(t *testing.T) {
+	this := NewEm(EmailUser{})
+
+	if got := this.encodeWord("ascii only"); got != "ascii only" {
+		t.Errorf("encodeWord(ascii) = %q, want unchanged", got)
+	}
+
+	if got := this.encodeWord("héllo"); got == "héllo" {
+		t.Errorf("encodeWord(non-ascii) returned input unchanged, want RFC 2047 encoded-word")
+	}
+}
+
+func TestEncodeContentQuotedPrintable(t *testing.T) {
+	this := NewEm(EmailUser{})
+
+	in := "100% = done"
+	var want bytes.Buffer
+	w := quotedprintable.NewWriter(&want)
+	w.Write([]byte(in))
+	w.Close()
+
+	if got := this.encodeContent(in); got != want.String() {
+		t.Errorf("encodeContent(quoted-printable) = %q, want %q", got, want.String())
+	}
+}
+
+func TestEncodeContentBase64(t *testing.T) {
+	this := NewEm(EmailUser{})
+	this.SetEncoding(Base64)
+
+	in := "hello world"
+	if got := this.encodeContent(in); got == in {
+		t.Errorf("encodeContent(base64) returned input unchanged, want base64")
+	}
+}
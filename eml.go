@@ -0,0 +1,217 @@
+package em
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zerobfd/mailbuilder" // "../mailbuilder"
+)
+
+// EMLToEm parses r as an RFC 5322 message - such as one produced by WriteEML,
+// or an export from a mail client - into an EM with From/To/Cc/Subject, the
+// decoded text/plain and text/html alternative parts, and any
+// attachments/inline images reconstructed.  All top-level headers, including
+// ones not otherwise modeled (Message-ID, Date, ...), are recorded on Headers
+// for inspection, but
+// WriteEML/SendIt build the outgoing message from Message/Mixed/Alt only, so
+// they are not re-emitted on a parse-then-serialize round trip.
+func EMLToEm(r io.Reader) (*EM, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error(12026): Unable to parse EML: %v", err)
+	}
+
+	this := NewEm(EmailUser{})
+	this.Headers = map[string][]string(msg.Header)
+
+	if addrs, aerr := msg.Header.AddressList("From"); aerr == nil && len(addrs) > 0 {
+		this.From(addrs[0].Address, decodeWord(addrs[0].Name))
+	}
+	if addrs, aerr := msg.Header.AddressList("To"); aerr == nil {
+		for _, a := range addrs {
+			this.To(a.Address, decodeWord(a.Name))
+		}
+	}
+	if addrs, aerr := msg.Header.AddressList("Cc"); aerr == nil {
+		for _, a := range addrs {
+			this.Cc(a.Address, decodeWord(a.Name))
+		}
+	}
+	if addrs, aerr := msg.Header.AddressList("Bcc"); aerr == nil {
+		for _, a := range addrs {
+			this.Bcc(a.Address, decodeWord(a.Name))
+		}
+	}
+	if subj := msg.Header.Get("Subject"); subj != "" {
+		this.Subject(decodeWord(subj))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if err := this.parsePart(mediaType, params, msg.Header, msg.Body); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// EMLFromFile parses the .eml file at path into an EM.  See EMLToEm.
+func EMLFromFile(path string) (*EM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error(12027): Unable to open EML file (%s): %v", path, err)
+	}
+	defer f.Close()
+	return EMLToEm(f)
+}
+
+// EMLFromString parses s, an RFC 5322 message, into an EM.  See EMLToEm.
+func EMLFromString(s string) (*EM, error) {
+	return EMLToEm(strings.NewReader(s))
+}
+
+// headerGetter is satisfied by both mail.Header (the top-level message
+// headers) and textproto.MIMEHeader (a multipart.Part's headers), letting
+// parsePart/parseLeaf handle either uniformly.
+type headerGetter interface {
+	Get(key string) string
+}
+
+// parsePart walks mediaType/body, recursing into multipart/mixed,
+// multipart/alternative, and multipart/related subtrees, and dispatching
+// each leaf part to parseLeaf.
+func (this *EM) parsePart(mediaType string, params map[string]string, header headerGetter, body io.Reader) error {
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return this.parseLeaf(mediaType, header, body)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error(12028): Unable to parse multipart body: %v", err)
+		}
+
+		pMediaType, pParams, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil {
+			pMediaType, pParams = "text/plain", map[string]string{}
+		}
+		if err := this.parsePart(pMediaType, pParams, p.Header, p); err != nil {
+			return err
+		}
+	}
+}
+
+// parseLeaf decodes a non-multipart part per its Content-Transfer-Encoding
+// and, based on its Content-Disposition/Content-ID, adds it to the EM as a
+// text/html alternative, an attachment, or an inline embed.  The
+// text/plain and text/html cases go through TextBody/HtmlBody so a
+// re-serialized part gets this.encoding's Content-Transfer-Encoding applied
+// again, instead of carrying the original encoding's raw decoded bytes.
+func (this *EM) parseLeaf(mediaType string, header headerGetter, body io.Reader) error {
+	content, err := decodeBody(body, strings.ToLower(header.Get("Content-Transfer-Encoding")))
+	if err != nil {
+		return fmt.Errorf("Error(12029): Unable to decode part body: %v", err)
+	}
+
+	disp, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	cid := strings.Trim(header.Get("Content-ID"), "<>")
+
+	switch {
+	case disp == "attachment":
+		this.attachBytes(content, dispParams["filename"], mediaType)
+	case cid != "" || disp == "inline":
+		fn := dispParams["filename"]
+		if fn == "" {
+			fn = cid
+		}
+		this.embedBytes(content, fn, cid, mediaType)
+	case mediaType == "text/html":
+		this.HtmlBody(string(content))
+	default:
+		this.TextBody(string(content))
+	}
+	return nil
+}
+
+// attachBytes adds content as an attachment named filename, the same way
+// Attach does for a file on disk.  Used by EMLToEm to reconstruct
+// attachments found while parsing.  Like Attach, it only collects the part -
+// attachBody wires it into Mixed later - since MIME part order inside
+// multipart/mixed is arbitrary and an attachment part may be seen before the
+// multipart/related part holding any inline images.
+func (this *EM) attachBytes(content []byte, filename string, contentType string) {
+	this.doAltSetup()
+
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+
+	attch := mailbuilder.NewSimplePart()
+	attch.AddHeader("Content-Type", contentType)
+	attch.AddHeader("Content-Transfer-Encoding", "base64")
+	attch.AddHeader("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, filename))
+	attch.Content = this.encodeBase64Lines(content)
+
+	this.attachments = append(this.attachments, attch)
+}
+
+// embedBytes adds content as an inline part with Content-ID cid, the same
+// way Embed does for a file on disk.  Used by EMLToEm to reconstruct inline
+// images found while parsing.
+func (this *EM) embedBytes(content []byte, filename string, cid string, contentType string) {
+	this.doAltSetup()
+
+	if this.Related == nil {
+		this.Related = mailbuilder.NewMultiPart("multipart/related")
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+
+	part := mailbuilder.NewSimplePart()
+	part.AddHeader("Content-Type", contentType)
+	part.AddHeader("Content-Transfer-Encoding", "base64")
+	part.AddHeader("Content-Disposition", fmt.Sprintf(`inline; filename=%q`, filename))
+	part.AddHeader("Content-ID", fmt.Sprintf("<%s>", cid))
+	part.Content = this.encodeBase64Lines(content)
+
+	this.Related.AddPart(part)
+}
+
+// decodeBody decodes body per cte, the part's Content-Transfer-Encoding.
+func decodeBody(body io.Reader, cte string) ([]byte, error) {
+	switch cte {
+	case "quoted-printable":
+		return ioutil.ReadAll(quotedprintable.NewReader(body))
+	case "base64":
+		return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+	default:
+		return ioutil.ReadAll(body)
+	}
+}
+
+// decodeWord RFC 2047 decodes an encoded-word header value, such as a
+// Subject or address display name.  Values that aren't encoded-words are
+// returned unchanged.
+func decodeWord(s string) string {
+	decoded, err := (&mime.WordDecoder{}).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
@@ -0,0 +1,44 @@
+package em
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestEMLRoundTrip builds a message, writes it to .eml, parses it back with
+// EMLToEm, and writes it out again, checking that the subject and body text
+// both survive - the case the chunk0-5 parseLeaf fix (routing text/html and
+// text/plain parts through HtmlBody/TextBody) was guarding against.
+func TestEMLRoundTrip(t *testing.T) {
+	msg := NewEm(EmailUser{})
+	msg.From("sender@example.com", "Sender").
+		To("rcpt@example.com", "Recipient").
+		Subject("Round trip").
+		TextBody("hello plain").
+		HtmlBody("<p>hello html</p>")
+
+	var buf bytes.Buffer
+	if err := msg.WriteEML(&buf); err != nil {
+		t.Fatalf("WriteEML: %v", err)
+	}
+
+	parsed, err := EMLFromString(buf.String())
+	if err != nil {
+		t.Fatalf("EMLFromString: %v", err)
+	}
+	if parsed.Message.Subject != "Round trip" {
+		t.Errorf("Subject = %q, want %q", parsed.Message.Subject, "Round trip")
+	}
+
+	var out bytes.Buffer
+	if err := parsed.WriteEML(&out); err != nil {
+		t.Fatalf("re-WriteEML: %v", err)
+	}
+	if !strings.Contains(out.String(), "hello html") {
+		t.Errorf("re-serialized message lost the html body: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "Content-Transfer-Encoding") {
+		t.Errorf("re-serialized html/text parts are missing a Content-Transfer-Encoding header: %s", out.String())
+	}
+}
@@ -0,0 +1,147 @@
+package em
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"github.com/zerobfd/mailbuilder" // "../mailbuilder"
+)
+
+// Sender is a persistent, authenticated SMTP connection that can be reused to
+// deliver many messages, avoiding the cost of dialing and authenticating for
+// every SendIt call.  Create one with (*EM).Dial and close it with Close when
+// done.
+type Sender struct {
+	em     *EM
+	client *smtp.Client
+
+	maxRetries int
+	retryDelay time.Duration
+}
+
+// Dial opens one authenticated SMTP session using this EM's EmailConfig, and
+// returns a Sender that can deliver many messages over it with Send.  This is
+// intended for newsletter/notification workloads where the per-message cost
+// of dialing and authenticating on every SendIt call dominates.
+func (this *EM) Dial() (*Sender, error) {
+	s := &Sender{em: this, maxRetries: 3, retryDelay: time.Second}
+	client, err := this.dialSmtp()
+	if err != nil {
+		return nil, this.sendError(err)
+	}
+	s.client = client
+	return s, nil
+}
+
+// SetRetry configures how many times Send retries a message after a
+// transient (4xx) SMTP error, and the initial backoff delay between
+// attempts; the delay doubles after each retry. The default is 3 retries
+// starting at 1 second.
+func (this *Sender) SetRetry(maxRetries int, delay time.Duration) {
+	this.maxRetries = maxRetries
+	this.retryDelay = delay
+}
+
+// Send delivers msg over this Sender's connection.  On a transient (4xx)
+// error, or if the server has closed the connection, it reconnects and
+// retries with exponential backoff up to maxRetries times.
+func (this *Sender) Send(msg *EM) error {
+	if !msg.altSetup {
+		return msg.sendError(errors.New("Error(12022): Can not send an email without a body or attachments."))
+	}
+	msg.attachBody()
+	msg.Message.SetBody(msg.Mixed)
+
+	from := msg.Message.From.Email
+	to := msg.Message.Recipients()
+	raw := msg.Message.Bytes()
+
+	delay := this.retryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = this.deliver(from, to, raw)
+		if err == nil {
+			break
+		}
+		if attempt >= this.maxRetries || !isTransient(err) {
+			break
+		}
+		this.client.Close()
+		if rerr := this.reconnect(); rerr != nil {
+			err = rerr
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if err != nil {
+		return msg.sendError(err)
+	}
+
+	msg.Message = mailbuilder.NewMessage()
+	return nil
+}
+
+// deliver runs one SMTP transaction (MAIL/RCPT/DATA) over the current
+// connection and resets it so it is ready for the next message.
+func (this *Sender) deliver(from string, to []string, raw []byte) error {
+	if err := this.client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := this.client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := this.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return this.client.Reset()
+}
+
+// reconnect re-dials and re-authenticates, replacing this.client.
+func (this *Sender) reconnect() error {
+	client, err := this.em.dialSmtp()
+	if err != nil {
+		return err
+	}
+	this.client = client
+	return nil
+}
+
+// isTransient reports whether err warrants a retry (with reconnect) rather
+// than giving up immediately: an SMTP 4xx reply, or the connection having
+// been closed out from under us (io.EOF/io.ErrUnexpectedEOF from a half
+// read, or a *net.OpError from the underlying socket).
+func isTransient(err error) bool {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 400 && tpErr.Code < 500
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr *net.OpError
+	return errors.As(err, &netErr)
+}
+
+// Close terminates the SMTP session.  Safe to call more than once.
+func (this *Sender) Close() error {
+	if this.client == nil {
+		return nil
+	}
+	err := this.client.Quit()
+	this.client = nil
+	return err
+}
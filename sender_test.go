@@ -0,0 +1,32 @@
+package em
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"4xx SMTP error", &textproto.Error{Code: 450, Msg: "mailbox busy"}, true},
+		{"5xx SMTP error", &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, false},
+		{"EOF", io.EOF, true},
+		{"wrapped EOF", fmt.Errorf("reading response: %w", io.EOF), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"net.OpError", &net.OpError{Op: "write", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"unrelated error", errors.New("some other failure"), false},
+	}
+
+	for _, c := range cases {
+		if got := isTransient(c.err); got != c.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", c.name, c.err, got, c.want)
+		}
+	}
+}
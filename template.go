@@ -0,0 +1,100 @@
+package em
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// readTemplate loads the named template source from the fs.FS set by
+// SetTemplateFS, or from the directory set by SetTemplateDir otherwise.
+func (this *EM) readTemplate(name string) ([]byte, error) {
+	if this.templateFS != nil {
+		return fs.ReadFile(this.templateFS, name)
+	}
+	return ioutil.ReadFile(filepath.Join(this.templateDir, name))
+}
+
+// templateError records and optionally prints a template failure, mirroring
+// the way sendError handles SMTP failures, and returns this so the builder
+// chain can keep going (the failure is visible on Err/SendIt).
+func (this *EM) templateError(code int, name string, err error) *EM {
+	this.Err = fmt.Errorf("Error(%d): Template (%s) error: %v", code, name, err)
+	if this.printErrors {
+		fmt.Printf("%v\n", this.Err)
+	}
+	return this
+}
+
+// TextTemplate renders the named text/template source - loaded via
+// SetTemplateDir or SetTemplateFS - against data, and uses the result as the
+// text body.
+func (this *EM) TextTemplate(name string, data interface{}) *EM {
+	src, err := this.readTemplate(name)
+	if err != nil {
+		return this.templateError(12035, name, err)
+	}
+
+	tpl, err := texttemplate.New(name).Parse(string(src))
+	if err != nil {
+		return this.templateError(12036, name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return this.templateError(12037, name, err)
+	}
+
+	return this.TextBody(buf.String())
+}
+
+// HtmlTemplate renders the named html/template source the same way
+// TextTemplate does, then scans the result for <img src="file:..."> or
+// src="cid:..."> references and automatically embeds each referenced file
+// with EmbedImage so the HTML body's images work without hand-writing MIME
+// parts.  Embeds made here are wired into the message by attachBody
+// regardless of whether Attach was called before or after HtmlTemplate.
+func (this *EM) HtmlTemplate(name string, data interface{}) *EM {
+	src, err := this.readTemplate(name)
+	if err != nil {
+		return this.templateError(12035, name, err)
+	}
+
+	tpl, err := htmltemplate.New(name).Parse(string(src))
+	if err != nil {
+		return this.templateError(12036, name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return this.templateError(12037, name, err)
+	}
+
+	return this.HtmlBody(this.autoEmbedImages(buf.String()))
+}
+
+// imgSrcRe matches an <img> src referencing either a "file:" path to embed
+// or a "cid:" name of a file to embed under that Content-ID.
+var imgSrcRe = regexp.MustCompile(`src="(?:file:|cid:)([^"]+)"`)
+
+// autoEmbedImages finds every file:/cid: image reference in html, embeds the
+// referenced file once each with EmbedImage, and rewrites the reference to
+// the canonical "cid:<basename>" form the embed was made under.
+func (this *EM) autoEmbedImages(html string) string {
+	embedded := map[string]bool{}
+	return imgSrcRe.ReplaceAllStringFunc(html, func(m string) string {
+		fn := imgSrcRe.FindStringSubmatch(m)[1]
+		cid := filepath.Base(fn)
+		if !embedded[cid] {
+			embedded[cid] = true
+			this.EmbedImage(fn)
+		}
+		return fmt.Sprintf(`src="cid:%s"`, cid)
+	})
+}
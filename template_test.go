@@ -0,0 +1,27 @@
+package em
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutoEmbedImages(t *testing.T) {
+	this := NewEm(EmailUser{})
+
+	html := `<img src="cid:logo.png"> <img src="file:/tmp/banner.png"> <img src="cid:logo.png">`
+	got := this.autoEmbedImages(html)
+
+	if !strings.Contains(got, `src="cid:logo.png"`) {
+		t.Errorf("cid: reference should be left as cid:logo.png, got %q", got)
+	}
+	if !strings.Contains(got, `src="cid:banner.png"`) {
+		t.Errorf("file: reference should be rewritten to its basename cid, got %q", got)
+	}
+	if strings.Contains(got, "file:") {
+		t.Errorf("file: reference was not rewritten: %q", got)
+	}
+
+	if this.Related == nil {
+		t.Fatalf("expected autoEmbedImages to embed images into Related")
+	}
+}
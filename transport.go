@@ -0,0 +1,205 @@
+package em
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Transport delivers a raw RFC 5322 message from from to the given
+// recipients.  SendIt dispatches through whichever Transport EmailConfig.Type
+// selects, so the delivery mechanism can be swapped without changing call
+// sites, and so the package can be tested without a real SMTP server (see
+// DevTransport).
+type Transport interface {
+	Send(from string, to []string, raw []byte) error
+}
+
+// transport returns the Transport implied by EM.Transport/EmailConfig.Type.
+// An explicitly set EM.Transport always wins; otherwise Type picks one of
+// the built-in Transports, defaulting to SMTP so existing configs keep
+// working unchanged.
+func (this *EM) transport() (Transport, error) {
+	if this.Transport != nil {
+		return this.Transport, nil
+	}
+
+	switch this.EmailConfig.Type {
+	case "", "smtp":
+		return &SMTPTransport{em: this}, nil
+	case "sendmail":
+		return &SendmailTransport{Path: this.EmailConfig.SendmailPath}, nil
+	case "mailgun":
+		return NewMailgunTransport(this.EmailConfig.Domain, this.EmailConfig.APIKey), nil
+	case "sendgrid":
+		return nil, errors.New("Error(12039): Type \"sendgrid\" has no built-in Transport - SendGrid's v3 API needs a structured JSON body, not raw MIME; set EM.Transport to your own Transport implementation")
+	case "ses":
+		return nil, errors.New("Error(12040): Type \"ses\" has no built-in Transport - SES's SendRawEmail action needs SigV4-signed requests; set EM.Transport to your own Transport implementation")
+	case "dev":
+		return &DevTransport{Dir: this.EmailConfig.DevDir}, nil
+	default:
+		return nil, fmt.Errorf("Error(12034): Unknown transport Type %q", this.EmailConfig.Type)
+	}
+}
+
+// SMTPTransport is the default Transport: it dials EmailConfig's server for
+// this one message, the same way SendIt worked before Transport was
+// introduced.  It reuses dialSmtp (em.go) and Sender's deliver (sender.go).
+type SMTPTransport struct {
+	em *EM
+}
+
+func (this *SMTPTransport) Send(from string, to []string, raw []byte) error {
+	client, err := this.em.dialSmtp()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	s := &Sender{em: this.em, client: client}
+	if err := s.deliver(from, to, raw); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SendmailTransport pipes the message to a local sendmail(1)-compatible
+// binary, the way most MTAs expect mail to be injected locally.
+type SendmailTransport struct {
+	Path string // defaults to /usr/sbin/sendmail
+	Args []string
+}
+
+func (this *SendmailTransport) Send(from string, to []string, raw []byte) error {
+	path := this.Path
+	if path == "" {
+		path = "/usr/sbin/sendmail"
+	}
+	args := this.Args
+	if args == nil {
+		args = append([]string{"-i", "-f", from, "--"}, to...)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(raw)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error(12030): sendmail failed: %v: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// HTTPTransport posts the raw MIME message to a provider's HTTP API instead
+// of over SMTP.  Endpoint is the full request URL; AuthHeader/AuthValue, if
+// set, are added to every request (e.g. "Authorization", "Bearer <key>").
+// If FormField is set, raw is attached as a multipart file under that field
+// name with the recipients as repeated "to" fields; otherwise raw is posted
+// as the whole request body.  Use NewMailgunTransport for Mailgun's defaults;
+// other providers need their own Transport - SendGrid's API doesn't accept a
+// raw MIME body and SES needs SigV4-signed requests - see EM.Transport.
+type HTTPTransport struct {
+	Endpoint   string
+	AuthHeader string
+	AuthValue  string
+	FormField  string
+	Client     *http.Client
+}
+
+func (this *HTTPTransport) httpClient() *http.Client {
+	if this.Client != nil {
+		return this.Client
+	}
+	return http.DefaultClient
+}
+
+func (this *HTTPTransport) Send(from string, to []string, raw []byte) error {
+	var body io.Reader
+	contentType := "message/rfc822"
+
+	if this.FormField != "" {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, rcpt := range to {
+			mw.WriteField("to", rcpt)
+		}
+		fw, err := mw.CreateFormFile(this.FormField, "message.mime")
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(raw); err != nil {
+			return err
+		}
+		if err := mw.Close(); err != nil {
+			return err
+		}
+		body = &buf
+		contentType = mw.FormDataContentType()
+	} else {
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest("POST", this.Endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if this.AuthHeader != "" {
+		req.Header.Set(this.AuthHeader, this.AuthValue)
+	}
+
+	resp, err := this.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("Error(12032): HTTP transport request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Error(12033): HTTP transport got status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// NewMailgunTransport posts to Mailgun's "messages.mime" endpoint, which
+// accepts a full raw MIME message, authenticated with HTTP basic auth using
+// "api" as the username and apiKey as the password.
+func NewMailgunTransport(domain, apiKey string) *HTTPTransport {
+	return &HTTPTransport{
+		Endpoint:   fmt.Sprintf("https://api.mailgun.net/v3/%s/messages.mime", domain),
+		AuthHeader: "Authorization",
+		AuthValue:  "Basic " + base64.StdEncoding.EncodeToString([]byte("api:"+apiKey)),
+		FormField:  "message",
+	}
+}
+
+// DevTransport doesn't deliver anything - it writes the raw MIME message to
+// a file in Dir (one per Send, named by timestamp) or, if Dir is empty, to
+// Writer (os.Stdout by default).  Intended for local development so the
+// package is testable without a real SMTP server.
+type DevTransport struct {
+	Dir    string
+	Writer io.Writer
+}
+
+func (this *DevTransport) Send(from string, to []string, raw []byte) error {
+	if this.Dir != "" {
+		fn := filepath.Join(this.Dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+		return ioutil.WriteFile(fn, raw, 0644)
+	}
+	w := this.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err := w.Write(raw)
+	return err
+}
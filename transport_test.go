@@ -0,0 +1,53 @@
+package em
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDevTransportWritesToDir(t *testing.T) {
+	dir := t.TempDir()
+	tr := &DevTransport{Dir: dir}
+	raw := []byte("Subject: test\r\n\r\nbody\r\n")
+
+	if err := tr.Send("from@example.com", []string{"to@example.com"}, raw); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 file written, got %d", len(entries))
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Errorf("written content = %q, want %q", got, raw)
+	}
+}
+
+func TestDevTransportWritesToWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tr := &DevTransport{Writer: &buf}
+
+	if err := tr.Send("from@example.com", []string{"to@example.com"}, []byte("hello")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("buf = %q, want %q", buf.String(), "hello")
+	}
+}
+
+func TestDevTransportDefaultsToStdout(t *testing.T) {
+	tr := &DevTransport{}
+	if err := tr.Send("from@example.com", []string{"to@example.com"}, []byte("hello")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}